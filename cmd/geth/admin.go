@@ -11,7 +11,9 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/logger/glog"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/xeth"
@@ -33,6 +35,8 @@ func (js *jsre) adminBindings() {
 	t, _ := js.re.Get("admin")
 	admin := t.Object()
 	admin.Set("addPeer", js.addPeer)
+	admin.Set("ping", js.ping)
+	admin.Set("crawl", js.crawl)
 	admin.Set("startRPC", js.startRPC)
 	admin.Set("stopRPC", js.stopRPC)
 	admin.Set("nodeInfo", js.nodeInfo)
@@ -61,6 +65,8 @@ func (js *jsre) adminBindings() {
 	debug.Set("getBlockRlp", js.getBlockRlp)
 	debug.Set("setHead", js.setHead)
 	debug.Set("processBlock", js.debugBlock)
+	debug.Set("dbStats", js.dbStats)
+	debug.Set("compactDb", js.compactDb)
 }
 
 func (js *jsre) getBlock(call otto.FunctionCall) (*types.Block, error) {
@@ -226,6 +232,44 @@ func (js *jsre) hashrate(otto.FunctionCall) otto.Value {
 	return js.re.ToVal(js.ethereum.Miner().HashRate())
 }
 
+// leveldbs returns the on-disk databases of the node by name.
+func (js *jsre) leveldbs() map[string]*ethdb.LDBDatabase {
+	dbs := make(map[string]*ethdb.LDBDatabase)
+	for name, db := range map[string]common.Database{
+		"blockchain": js.ethereum.BlockDb(),
+		"state":      js.ethereum.StateDb(),
+		"extra":      js.ethereum.ExtraDb(),
+	} {
+		if ldb, ok := db.(*ethdb.LDBDatabase); ok {
+			dbs[name] = ldb
+		}
+	}
+	return dbs
+}
+
+func (js *jsre) dbStats(call otto.FunctionCall) otto.Value {
+	stats := make(map[string]*ethdb.LDBStats)
+	for name, db := range js.leveldbs() {
+		s, err := db.Stats()
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			return otto.UndefinedValue()
+		}
+		stats[name] = s
+	}
+	return js.re.ToVal(stats)
+}
+
+func (js *jsre) compactDb(call otto.FunctionCall) otto.Value {
+	for name, db := range js.leveldbs() {
+		if err := db.Compact(nil, nil); err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			return otto.FalseValue()
+		}
+	}
+	return otto.TrueValue()
+}
+
 func (js *jsre) backtrace(call otto.FunctionCall) otto.Value {
 	tracestr, err := call.Argument(0).ToString()
 	if err != nil {
@@ -328,6 +372,62 @@ func (js *jsre) addPeer(call otto.FunctionCall) otto.Value {
 	return otto.TrueValue()
 }
 
+func (js *jsre) ping(call otto.FunctionCall) otto.Value {
+	nodeURL, err := call.Argument(0).ToString()
+	if err != nil {
+		fmt.Println(err)
+		return otto.FalseValue()
+	}
+	res, err := js.ethereum.PingNode(nodeURL)
+	if err != nil {
+		fmt.Println(err)
+		return otto.FalseValue()
+	}
+	return js.re.ToVal(&pingInfo{
+		RTT:      res.RTT.String(),
+		SeenIP:   res.Seen.IP.String(),
+		SeenPort: res.Seen.Port,
+	})
+}
+
+type pingInfo struct {
+	RTT      string
+	SeenIP   string // our IP as seen by the remote node
+	SeenPort int    // our UDP port as seen by the remote node
+}
+
+type crawlInfo struct {
+	NodeUrl  string
+	NodeID   string
+	IP       string
+	DiscPort int // UDP listening port for discovery protocol
+	TCPPort  int // TCP listening port for RLPx
+}
+
+func (js *jsre) crawl(call otto.FunctionCall) otto.Value {
+	if !call.Argument(0).IsNumber() {
+		fmt.Println("first argument must be the maximum number of nodes")
+		return otto.FalseValue()
+	}
+	maxNodes, _ := call.Argument(0).ToInteger()
+	found := make(chan *discover.Node)
+	if err := js.ethereum.CrawlNetwork(int(maxNodes), found); err != nil {
+		fmt.Println(err)
+		return otto.FalseValue()
+	}
+	var nodes []*crawlInfo
+	for n := range found {
+		nodes = append(nodes, &crawlInfo{
+			NodeUrl:  n.String(),
+			NodeID:   n.ID.String(),
+			IP:       n.IP.String(),
+			DiscPort: int(n.UDP),
+			TCPPort:  int(n.TCP),
+		})
+	}
+	return js.re.ToVal(nodes)
+}
+
 func (js *jsre) unlock(call otto.FunctionCall) otto.Value {
 	addr, err := call.Argument(0).ToString()
 	if err != nil {
@@ -77,6 +77,7 @@ func init() {
 		utils.MaxPeersFlag,
 		utils.MinerThreadsFlag,
 		utils.NATFlag,
+		utils.NetrestrictFlag,
 		utils.NodeKeyFileFlag,
 		utils.RPCListenAddrFlag,
 		utils.RPCPortFlag,
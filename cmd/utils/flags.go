@@ -21,6 +21,7 @@ import (
 	"github.com/ethereum/go-ethereum/logger"
 	"github.com/ethereum/go-ethereum/logger/glog"
 	"github.com/ethereum/go-ethereum/p2p/nat"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/xeth"
 )
@@ -220,6 +221,10 @@ var (
 		Usage: "NAT port mapping mechanism (any|none|upnp|pmp|extip:<IP>)",
 		Value: "any",
 	}
+	NetrestrictFlag = cli.StringFlag{
+		Name:  "netrestrict",
+		Usage: "Restricts node discovery to the given IP networks (comma-separated CIDR masks)",
+	}
 	WhisperEnabledFlag = cli.BoolFlag{
 		Name:  "shh",
 		Usage: "Enable whisper",
@@ -239,6 +244,24 @@ func GetNAT(ctx *cli.Context) nat.Interface {
 	return natif
 }
 
+// GetNetrestrict parses the --netrestrict flag. It returns nil if the
+// flag is not set. A value that contains no networks is rejected because
+// it would block all discovery traffic.
+func GetNetrestrict(ctx *cli.Context) *netutil.Netlist {
+	netrestrict := ctx.GlobalString(NetrestrictFlag.Name)
+	if netrestrict == "" {
+		return nil
+	}
+	list, err := netutil.ParseNetlist(netrestrict)
+	if err != nil {
+		Fatalf("Option %q: %v", NetrestrictFlag.Name, err)
+	}
+	if len(*list) == 0 {
+		Fatalf("Option %q: no networks given", NetrestrictFlag.Name)
+	}
+	return list
+}
+
 func GetNodeKey(ctx *cli.Context) (key *ecdsa.PrivateKey) {
 	hex, file := ctx.GlobalString(NodeKeyHexFlag.Name), ctx.GlobalString(NodeKeyFileFlag.Name)
 	var err error
@@ -288,6 +311,7 @@ func MakeEthConfig(clientID, version string, ctx *cli.Context) *eth.Config {
 		MaxPeers:           ctx.GlobalInt(MaxPeersFlag.Name),
 		Port:               ctx.GlobalString(ListenPortFlag.Name),
 		NAT:                GetNAT(ctx),
+		NetRestrict:        GetNetrestrict(ctx),
 		NatSpec:            ctx.GlobalBool(NatspecEnabledFlag.Name),
 		NodeKey:            GetNodeKey(ctx),
 		Shh:                ctx.GlobalBool(WhisperEnabledFlag.Name),
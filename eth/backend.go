@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/p2p/nat"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
 	"github.com/ethereum/go-ethereum/whisper"
 )
 
@@ -74,6 +75,9 @@ type Config struct {
 	Shh  bool
 	Dial bool
 
+	// If non-nil, node discovery is restricted to these networks.
+	NetRestrict *netutil.Netlist
+
 	Etherbase      string
 	MinerThreads   int
 	AccountManager *accounts.Manager
@@ -285,6 +289,7 @@ func New(config *Config) (*Ethereum, error) {
 		MaxPeers:       config.MaxPeers,
 		Protocols:      protocols,
 		NAT:            config.NAT,
+		Discovery:      discover.Config{NetRestrict: config.NetRestrict},
 		NoDial:         !config.Dial,
 		BootstrapNodes: config.parseBootNodes(),
 		StaticNodes:    config.parseNodes(staticNodes),
@@ -495,6 +500,22 @@ func (self *Ethereum) AddPeer(nodeURL string) error {
 	return nil
 }
 
+// PingNode sends a discovery ping to the given node and returns the
+// measured round-trip time and the endpoint the node saw us at.
+func (self *Ethereum) PingNode(nodeURL string) (*discover.PingResult, error) {
+	n, err := discover.ParseNode(nodeURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node URL: %v", err)
+	}
+	return self.net.Ping(n)
+}
+
+// CrawlNetwork enumerates the discovery network, sending up to maxNodes
+// nodes on found. found is closed when the crawl ends.
+func (self *Ethereum) CrawlNetwork(maxNodes int, found chan<- *discover.Node) error {
+	return self.net.Crawl(maxNodes, found)
+}
+
 func (s *Ethereum) Stop() {
 	s.txSub.Unsubscribe() // quits txBroadcastLoop
 
@@ -1,13 +1,16 @@
 package ethdb
 
 import (
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/compression/rle"
 	"github.com/ethereum/go-ethereum/logger"
 	"github.com/ethereum/go-ethereum/logger/glog"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type LDBDatabase struct {
@@ -18,9 +21,23 @@ type LDBDatabase struct {
 
 	queue map[string][]byte
 
+	// disk access counters, protected by mu
+	reads, writes       uint64
+	readTime, writeTime time.Duration
+
 	quit chan struct{}
 }
 
+// LDBStats contains access and compaction statistics of a LDBDatabase.
+type LDBStats struct {
+	Reads      uint64        // number of reads that went to disk
+	ReadTime   time.Duration // total time spent in those reads
+	Writes     uint64        // number of batch writes and deletes
+	WriteTime  time.Duration // total time spent in those writes
+	OpenTables int           // number of currently opened table files
+	Compaction string        // per-level compaction statistics reported by leveldb
+}
+
 func NewLDBDatabase(file string) (*LDBDatabase, error) {
 	// Open the db
 	db, err := leveldb.OpenFile(file, nil)
@@ -65,7 +82,10 @@ func (self *LDBDatabase) Get(key []byte) ([]byte, error) {
 		return dat, nil
 	}
 
+	start := time.Now()
 	dat, err := self.db.Get(key, nil)
+	self.reads++
+	self.readTime += time.Since(start)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +100,12 @@ func (self *LDBDatabase) Delete(key []byte) error {
 	// make sure it's not in the queue
 	delete(self.queue, string(key))
 
-	return self.db.Delete(key, nil)
+	start := time.Now()
+	err := self.db.Delete(key, nil)
+	self.writes++
+	self.writeTime += time.Since(start)
+
+	return err
 }
 
 func (self *LDBDatabase) LastKnownTD() []byte {
@@ -101,6 +126,9 @@ func (self *LDBDatabase) Flush() error {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
+	if len(self.queue) == 0 {
+		return nil
+	}
 	batch := new(leveldb.Batch)
 
 	for key, value := range self.queue {
@@ -110,7 +138,51 @@ func (self *LDBDatabase) Flush() error {
 
 	glog.V(logger.Detail).Infoln("Flush database: ", self.fn)
 
-	return self.db.Write(batch, nil)
+	start := time.Now()
+	err := self.db.Write(batch, nil)
+	self.writes++
+	self.writeTime += time.Since(start)
+
+	return err
+}
+
+// Stats returns the access counters of the database together with the
+// current leveldb table and compaction statistics.
+func (self *LDBDatabase) Stats() (*LDBStats, error) {
+	self.mu.Lock()
+	stats := &LDBStats{
+		Reads:     self.reads,
+		ReadTime:  self.readTime,
+		Writes:    self.writes,
+		WriteTime: self.writeTime,
+	}
+	self.mu.Unlock()
+
+	var err error
+	if stats.Compaction, err = self.db.GetProperty("leveldb.stats"); err != nil {
+		return nil, err
+	}
+	tables, err := self.db.GetProperty("leveldb.openedtables")
+	if err != nil {
+		return nil, err
+	}
+	if stats.OpenTables, err = strconv.Atoi(tables); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Compact flushes all queued writes and then compacts the underlying
+// storage for the key range [start, limit). A nil start is treated as
+// a key before all keys and a nil limit as a key after all keys, so
+// Compact(nil, nil) compacts the whole database.
+func (self *LDBDatabase) Compact(start, limit []byte) error {
+	if err := self.Flush(); err != nil {
+		return err
+	}
+	glog.V(logger.Info).Infoln("Compacting database:", self.fn)
+
+	return self.db.CompactRange(util.Range{Start: start, Limit: limit})
 }
 
 func (self *LDBDatabase) Close() {
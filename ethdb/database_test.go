@@ -3,6 +3,7 @@ package ethdb
 import (
 	"os"
 	"path"
+	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -17,3 +18,37 @@ func newDb() *LDBDatabase {
 
 	return db
 }
+
+func TestLDBStats(t *testing.T) {
+	db := newDb()
+	defer db.Close()
+
+	db.Put([]byte("key"), []byte("value"))
+	if err := db.Flush(); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	if v, err := db.Get([]byte("key")); err != nil || string(v) != "value" {
+		t.Fatalf("get returned %q, %v", v, err)
+	}
+	if err := db.Compact(nil, nil); err != nil {
+		t.Fatalf("compact error: %v", err)
+	}
+	if v, err := db.Get([]byte("key")); err != nil || string(v) != "value" {
+		t.Fatalf("get after compaction returned %q, %v", v, err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	if stats.Reads != 2 {
+		t.Errorf("got %d reads, want 2", stats.Reads)
+	}
+	// the flush before compaction has nothing to write and isn't counted.
+	if stats.Writes != 1 {
+		t.Errorf("got %d writes, want 1", stats.Writes)
+	}
+	if stats.Compaction == "" {
+		t.Error("missing compaction statistics")
+	}
+}
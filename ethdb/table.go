@@ -0,0 +1,48 @@
+package ethdb
+
+import "github.com/ethereum/go-ethereum/common"
+
+// table is a wrapper around a database that prefixes each key access
+// with a pre-configured string.
+type table struct {
+	db     common.Database
+	prefix string
+}
+
+// NewTable returns a Database object that prefixes all keys with a given
+// string. This allows several subsystems to share a single underlying
+// database without their keys colliding.
+//
+// Closing a table does not close the underlying database, which is
+// owned by the caller.
+func NewTable(db common.Database, prefix string) common.Database {
+	return &table{
+		db:     db,
+		prefix: prefix,
+	}
+}
+
+func (self *table) Put(key []byte, value []byte) {
+	self.db.Put(append([]byte(self.prefix), key...), value)
+}
+
+func (self *table) Get(key []byte) ([]byte, error) {
+	return self.db.Get(append([]byte(self.prefix), key...))
+}
+
+func (self *table) Delete(key []byte) error {
+	return self.db.Delete(append([]byte(self.prefix), key...))
+}
+
+// LastKnownTD is not namespaced, it is read from the underlying database.
+func (self *table) LastKnownTD() []byte {
+	return self.db.LastKnownTD()
+}
+
+func (self *table) Flush() error {
+	return self.db.Flush()
+}
+
+func (self *table) Close() {
+	// Do nothing; don't close the underlying DB.
+}
@@ -0,0 +1,37 @@
+package ethdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTablePrefix(t *testing.T) {
+	db, _ := NewMemDatabase()
+	a, b := NewTable(db, "a-"), NewTable(db, "b-")
+
+	a.Put([]byte("key"), []byte("value a"))
+	b.Put([]byte("key"), []byte("value b"))
+
+	if v, _ := a.Get([]byte("key")); !bytes.Equal(v, []byte("value a")) {
+		t.Errorf("table a: got %q, want %q", v, "value a")
+	}
+	if v, _ := b.Get([]byte("key")); !bytes.Equal(v, []byte("value b")) {
+		t.Errorf("table b: got %q, want %q", v, "value b")
+	}
+	if v, _ := db.Get([]byte("a-key")); !bytes.Equal(v, []byte("value a")) {
+		t.Errorf("underlying db: got %q, want %q", v, "value a")
+	}
+	if v, _ := db.Get([]byte("key")); v != nil {
+		t.Errorf("unprefixed key present in underlying db: %q", v)
+	}
+
+	if err := a.Delete([]byte("key")); err != nil {
+		t.Fatalf("delete error: %v", err)
+	}
+	if v, _ := a.Get([]byte("key")); v != nil {
+		t.Errorf("table a: key still present after delete: %q", v)
+	}
+	if v, _ := b.Get([]byte("key")); !bytes.Equal(v, []byte("value b")) {
+		t.Errorf("table b: delete in table a removed %q", v)
+	}
+}
@@ -262,6 +262,12 @@ func (db *nodeDB) updateLastPong(id NodeID, instance time.Time) error {
 	return db.storeInt64(makeKey(id, nodeDBDiscoverPong), instance.Unix())
 }
 
+// hasBond reports whether the given node is considered bonded, i.e. it
+// has successfully answered a ping within the node expiration period.
+func (db *nodeDB) hasBond(id NodeID) bool {
+	return time.Since(db.lastPong(id)) < nodeDBNodeExpiration
+}
+
 // querySeeds retrieves a batch of nodes to be used as potential seed servers
 // during bootstrapping the node into the network.
 //
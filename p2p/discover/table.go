@@ -20,12 +20,14 @@ import (
 )
 
 const (
-	alpha      = 3  // Kademlia concurrency factor
-	bucketSize = 16 // Kademlia bucket size
-	hashBits   = len(common.Hash{}) * 8
-	nBuckets   = hashBits + 1 // Number of buckets
+	defaultAlpha = 3  // Kademlia concurrency factor
+	bucketSize   = 16 // Kademlia bucket size
+	hashBits     = len(common.Hash{}) * 8
+	nBuckets     = hashBits + 1 // Number of buckets
 
 	maxBondingPingPongs = 10
+
+	crawlDepth = 14 // number of buckets queried per node during a crawl
 )
 
 type Table struct {
@@ -38,8 +40,9 @@ type Table struct {
 	bonding   map[NodeID]*bondproc
 	bondslots chan struct{} // limits total number of active bonding processes
 
-	net  transport
-	self *Node // metadata of the local node
+	net   transport
+	self  *Node // metadata of the local node
+	alpha int   // number of concurrent queries during lookup
 }
 
 type bondproc struct {
@@ -52,7 +55,7 @@ type bondproc struct {
 // it is an interface so we can test without opening lots of UDP
 // sockets and without generating a private key.
 type transport interface {
-	ping(NodeID, *net.UDPAddr) error
+	ping(NodeID, *net.UDPAddr) (*PingResult, error)
 	waitping(NodeID) error
 	findnode(toid NodeID, addr *net.UDPAddr, target NodeID) ([]*Node, error)
 	close()
@@ -66,7 +69,7 @@ type bucket struct {
 	entries    []*Node
 }
 
-func newTable(t transport, ourID NodeID, ourAddr *net.UDPAddr, nodeDBPath string) *Table {
+func newTable(t transport, ourID NodeID, ourAddr *net.UDPAddr, nodeDBPath string, cfg Config) *Table {
 	// If no node database was given, use an in-memory one
 	db, err := newNodeDB(nodeDBPath, Version)
 	if err != nil {
@@ -79,6 +82,7 @@ func newTable(t transport, ourID NodeID, ourAddr *net.UDPAddr, nodeDBPath string
 		self:      newNode(ourID, ourAddr.IP, uint16(ourAddr.Port), uint16(ourAddr.Port)),
 		bonding:   make(map[NodeID]*bondproc),
 		bondslots: make(chan struct{}, maxBondingPingPongs),
+		alpha:     cfg.withDefaults().Alpha,
 	}
 	for i := 0; i < cap(tab.bondslots); i++ {
 		tab.bondslots <- struct{}{}
@@ -123,11 +127,18 @@ func (tab *Table) Bootstrap(nodes []*Node) {
 // The given target does not need to be an actual node
 // identifier.
 func (tab *Table) Lookup(targetID NodeID) []*Node {
+	return tab.LookupCancel(targetID, nil)
+}
+
+// LookupCancel is like Lookup, but stops the search when the cancel
+// channel is closed. The nodes found up to that point are returned
+// without waiting for the queries still in flight.
+func (tab *Table) LookupCancel(targetID NodeID, cancel <-chan struct{}) []*Node {
 	var (
 		target         = crypto.Sha3Hash(targetID[:])
 		asked          = make(map[NodeID]bool)
 		seen           = make(map[NodeID]bool)
-		reply          = make(chan []*Node, alpha)
+		reply          = make(chan []*Node, tab.alpha)
 		pendingQueries = 0
 	)
 	// don't query further if we hit ourself.
@@ -143,7 +154,7 @@ func (tab *Table) Lookup(targetID NodeID) []*Node {
 
 	for {
 		// ask the alpha closest nodes that we haven't asked yet
-		for i := 0; i < len(result.entries) && pendingQueries < alpha; i++ {
+		for i := 0; i < len(result.entries) && pendingQueries < tab.alpha; i++ {
 			n := result.entries[i]
 			if !asked[n.ID] {
 				asked[n.ID] = true
@@ -159,17 +170,132 @@ func (tab *Table) Lookup(targetID NodeID) []*Node {
 			break
 		}
 		// wait for the next reply
-		for _, n := range <-reply {
-			if n != nil && !seen[n.ID] {
-				seen[n.ID] = true
-				result.push(n, bucketSize)
+		select {
+		case nodes := <-reply:
+			for _, n := range nodes {
+				if n != nil && !seen[n.ID] {
+					seen[n.ID] = true
+					result.push(n, bucketSize)
+				}
 			}
+		case <-cancel:
+			// the reply channel is buffered for all pending
+			// queries, so they can still finish.
+			return result.entries
 		}
 		pendingQueries--
 	}
 	return result.entries
 }
 
+// Crawl enumerates the part of the network that is reachable from the
+// table. Starting with the nodes currently in the table, it asks every
+// node it learns about for the content of its table and bonds with the
+// nodes returned. Each node found is sent on the found channel, which
+// is closed when the crawl ends. The crawl ends when no new nodes turn
+// up, when maxNodes nodes have been found or when cancel is closed.
+func (tab *Table) Crawl(maxNodes int, found chan<- *Node, cancel <-chan struct{}) {
+	defer close(found)
+	var (
+		seen           = make(map[NodeID]bool)
+		queue          []*Node
+		nfound         = 0
+		reply          = make(chan []*Node, tab.alpha)
+		pendingQueries = 0
+	)
+	seen[tab.self.ID] = true
+	// add reports a node and queues it for querying. It returns
+	// false if the crawl was canceled while reporting.
+	add := func(n *Node) bool {
+		if n == nil || seen[n.ID] || nfound >= maxNodes {
+			return true
+		}
+		seen[n.ID] = true
+		nfound++
+		queue = append(queue, n)
+		select {
+		case found <- n:
+			return true
+		case <-cancel:
+			return false
+		}
+	}
+
+	tab.mutex.Lock()
+	var initial []*Node
+	for _, b := range tab.buckets {
+		initial = append(initial, b.entries...)
+	}
+	tab.mutex.Unlock()
+	for _, n := range initial {
+		if !add(n) {
+			return
+		}
+	}
+
+	for len(queue) > 0 || pendingQueries > 0 {
+		for len(queue) > 0 && pendingQueries < tab.alpha {
+			n := queue[0]
+			queue = queue[1:]
+			pendingQueries++
+			go func() { reply <- tab.crawlNode(n) }()
+		}
+		select {
+		case nodes := <-reply:
+			for _, n := range nodes {
+				if !add(n) {
+					return
+				}
+			}
+		case <-cancel:
+			return
+		}
+		pendingQueries--
+	}
+}
+
+// crawlNode asks n for the nodes in its table, one bucket at a time.
+// A findnode reply holds the bucketSize nodes closest to the target, so
+// the remote answers a target at log distance ld from itself with its
+// bucket ld, followed by the closest nodes of its other buckets. The
+// query moves on to the next closer bucket as long as the reply is full
+// and made up of nodes at distance ld or less, i.e. there may be more.
+func (tab *Table) crawlNode(n *Node) []*Node {
+	var (
+		seen   = make(map[NodeID]bool)
+		result []*Node
+	)
+	for ld := hashBits; ld > hashBits-crawlDepth; ld-- {
+		r, err := tab.net.findnode(n.ID, n.addr(), crawlTarget(n.sha, ld))
+		more := len(r) >= bucketSize
+		for _, rn := range r {
+			if !seen[rn.ID] {
+				seen[rn.ID] = true
+				result = append(result, rn)
+			}
+			if logdist(n.sha, rn.sha) > ld {
+				more = false
+			}
+		}
+		if err != nil || !more {
+			break
+		}
+	}
+	return tab.bondall(result)
+}
+
+// crawlTarget returns a random findnode target whose hash is at log
+// distance ld from the given hash. Finding one takes about 2^(hashBits-ld+1)
+// attempts, which bounds the depth of a crawl.
+func crawlTarget(sha common.Hash, ld int) (target NodeID) {
+	for {
+		rand.Read(target[:])
+		if logdist(sha, crypto.Sha3Hash(target[:])) == ld {
+			return target
+		}
+	}
+}
+
 // refresh performs a lookup for a random target to keep buckets full.
 func (tab *Table) refresh() {
 	// The Kademlia paper specifies that the bucket refresh should
@@ -255,9 +381,13 @@ func (tab *Table) bondall(nodes []*Node) (result []*Node) {
 //
 // If pinged is true, the remote node has just pinged us and one half
 // of the process can be skipped.
+//
+// A bond is only valid for the endpoint that answered the ping. If the
+// remote node is contacted at a different endpoint, it is bonded again
+// so the database records its new address.
 func (tab *Table) bond(pinged bool, id NodeID, addr *net.UDPAddr, tcpPort uint16) (*Node, error) {
 	var n *Node
-	if n = tab.db.node(id); n == nil {
+	if n = tab.db.node(id); n == nil || !tab.db.hasBond(id) || !n.IP.Equal(addr.IP) || int(n.UDP) != addr.Port {
 		tab.bondmu.Lock()
 		w := tab.bonding[id]
 		if w != nil {
@@ -296,7 +426,7 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeID, addr *net.UDPAdd
 	defer func() { tab.bondslots <- struct{}{} }()
 
 	// Ping the remote side and wait for a pong
-	if w.err = tab.ping(id, addr); w.err != nil {
+	if _, w.err = tab.ping(id, addr); w.err != nil {
 		close(w.done)
 		return
 	}
@@ -315,7 +445,7 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeID, addr *net.UDPAdd
 func (tab *Table) pingreplace(new *Node, b *bucket) {
 	if len(b.entries) == bucketSize {
 		oldest := b.entries[bucketSize-1]
-		if err := tab.ping(oldest.ID, oldest.addr()); err == nil {
+		if _, err := tab.ping(oldest.ID, oldest.addr()); err == nil {
 			// The node responded, we don't need to replace it.
 			return
 		}
@@ -328,19 +458,31 @@ func (tab *Table) pingreplace(new *Node, b *bucket) {
 	b.entries[0] = new
 }
 
+// PingResult describes a completed ping/pong exchange.
+type PingResult struct {
+	RTT  time.Duration // time between sending the ping and receiving the pong
+	Seen *net.UDPAddr  // our endpoint as observed by the remote node
+}
+
+// Ping sends a ping to the given node and waits for the matching pong.
+func (tab *Table) Ping(n *Node) (*PingResult, error) {
+	return tab.ping(n.ID, n.addr())
+}
+
 // ping a remote endpoint and wait for a reply, also updating the node database
 // accordingly.
-func (tab *Table) ping(id NodeID, addr *net.UDPAddr) error {
+func (tab *Table) ping(id NodeID, addr *net.UDPAddr) (*PingResult, error) {
 	// Update the last ping and send the message
 	tab.db.updateLastPing(id, time.Now())
-	if err := tab.net.ping(id, addr); err != nil {
-		return err
+	res, err := tab.net.ping(id, addr)
+	if err != nil {
+		return nil, err
 	}
 	// Pong received, update the database and return
 	tab.db.updateLastPong(id, time.Now())
 	tab.db.ensureExpirer()
 
-	return nil
+	return res, nil
 }
 
 // add puts the entries into the table if their corresponding
@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"testing"
 	"testing/quick"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -17,7 +18,7 @@ import (
 func TestTable_pingReplace(t *testing.T) {
 	doit := func(newNodeIsResponding, lastInBucketIsResponding bool) {
 		transport := newPingRecorder()
-		tab := newTable(transport, NodeID{}, &net.UDPAddr{}, "")
+		tab := newTable(transport, NodeID{}, &net.UDPAddr{}, "", Config{})
 		pingSender := newNode(MustHexID("a502af0f59b2aab7746995408c79e9ca312d2793cc997e44fc55eda62f0150bbb8c59a6f9269ba3a081518b62699ee807c7c19c20125ddfccca872608af9e370"), net.IP{}, 99, 99)
 
 		// fill up the sender's bucket.
@@ -70,6 +71,29 @@ func TestTable_pingReplace(t *testing.T) {
 	doit(false, false)
 }
 
+func TestTable_Ping(t *testing.T) {
+	transport := newPingRecorder()
+	tab := newTable(transport, NodeID{}, &net.UDPAddr{}, "", Config{})
+	defer tab.db.close()
+
+	n := nodeAtDistance(tab.self.sha, 200)
+	if _, err := tab.Ping(n); err != errTimeout {
+		t.Errorf("got error %v for unresponsive node, want %v", err, errTimeout)
+	}
+	transport.responding[n.ID] = true
+	if res, err := tab.Ping(n); err != nil {
+		t.Errorf("ping error: %v", err)
+	} else if res.RTT != time.Millisecond {
+		t.Errorf("got round-trip time %v, want %v", res.RTT, time.Millisecond)
+	}
+	if !transport.pinged[n.ID] {
+		t.Error("node was not pinged")
+	}
+	if tab.db.lastPong(n.ID).Unix() == 0 {
+		t.Error("last pong not recorded in node database")
+	}
+}
+
 func TestBucket_bumpNoDuplicates(t *testing.T) {
 	t.Parallel()
 	cfg := &quick.Config{
@@ -147,12 +171,12 @@ func (t *pingRecorder) close() {
 func (t *pingRecorder) waitping(from NodeID) error {
 	return nil // remote always pings
 }
-func (t *pingRecorder) ping(toid NodeID, toaddr *net.UDPAddr) error {
+func (t *pingRecorder) ping(toid NodeID, toaddr *net.UDPAddr) (*PingResult, error) {
 	t.pinged[toid] = true
 	if t.responding[toid] {
-		return nil
+		return &PingResult{RTT: time.Millisecond, Seen: toaddr}, nil
 	} else {
-		return errTimeout
+		return nil, errTimeout
 	}
 }
 
@@ -161,7 +185,7 @@ func TestTable_closest(t *testing.T) {
 
 	test := func(test *closeTest) bool {
 		// for any node table, Target and N
-		tab := newTable(nil, test.Self, &net.UDPAddr{}, "")
+		tab := newTable(nil, test.Self, &net.UDPAddr{}, "", Config{})
 		tab.add(test.All)
 
 		// check that doClosest(Target, N) returns nodes
@@ -231,7 +255,7 @@ func (*closeTest) Generate(rand *rand.Rand, size int) reflect.Value {
 
 func TestTable_Lookup(t *testing.T) {
 	self := nodeAtDistance(common.Hash{}, 0)
-	tab := newTable(lookupTestnet, self.ID, &net.UDPAddr{}, "")
+	tab := newTable(lookupTestnet, self.ID, &net.UDPAddr{}, "", Config{})
 
 	// lookup on empty table returns no nodes
 	if results := tab.Lookup(lookupTestnet.target); len(results) > 0 {
@@ -258,6 +282,196 @@ func TestTable_Lookup(t *testing.T) {
 	// TODO: check result nodes are actually closest
 }
 
+func TestTable_LookupCancel(t *testing.T) {
+	transport := &hangingTestnet{release: make(chan struct{})}
+	defer close(transport.release)
+	tab := newTable(transport, NodeID{}, &net.UDPAddr{}, "", Config{})
+	defer tab.db.close()
+
+	seed := nodeAtDistance(tab.self.sha, 200)
+	tab.add([]*Node{seed})
+
+	cancel := make(chan struct{})
+	close(cancel)
+	done := make(chan []*Node)
+	go func() { done <- tab.LookupCancel(testTarget, cancel) }()
+	select {
+	case results := <-done:
+		if len(results) != 1 || results[0] != seed {
+			t.Errorf("wrong results: got %v, want %v", results, []*Node{seed})
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lookup did not return after cancel")
+	}
+}
+
+// hangingTestnet is a transport that doesn't answer findnode
+// until the release channel is closed.
+type hangingTestnet struct {
+	release chan struct{}
+}
+
+func (tn *hangingTestnet) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node, error) {
+	<-tn.release
+	return nil, errTimeout
+}
+
+func (*hangingTestnet) close()                     {}
+func (*hangingTestnet) waitping(from NodeID) error { return nil }
+func (*hangingTestnet) ping(toid NodeID, toaddr *net.UDPAddr) (*PingResult, error) {
+	return &PingResult{}, nil
+}
+
+func TestTable_crawlNode(t *testing.T) {
+	testnet := newCrawlTestnet(300)
+	tab := newTable(testnet, NodeID{}, &net.UDPAddr{}, "", Config{})
+	defer tab.db.close()
+
+	// the hub's table spans several buckets, more than
+	// a single findnode reply can hold.
+	want := testnet.tables[0]
+	if len(want) <= bucketSize {
+		t.Fatalf("test network too small: hub knows %d nodes", len(want))
+	}
+	got := tab.crawlNode(testnet.nodes[0])
+	if len(got) != len(want) {
+		t.Errorf("wrong number of results: got %d, want %d", len(got), len(want))
+	}
+	for _, n := range want {
+		if !contains(got, n.ID) {
+			t.Errorf("node %x missing from results", n.ID[:8])
+		}
+	}
+}
+
+func TestTable_Crawl(t *testing.T) {
+	testnet := newCrawlTestnet(300)
+	tab := newTable(testnet, NodeID{}, &net.UDPAddr{}, "", Config{})
+	defer tab.db.close()
+
+	// crawl on empty table finds no nodes
+	if results := crawlAll(tab, 1000); len(results) > 0 {
+		t.Fatalf("crawl on empty table returned %d results", len(results))
+	}
+	tab.add([]*Node{testnet.nodes[0]})
+
+	results := crawlAll(tab, 1000)
+	if want := testnet.reachable(0); len(results) != want {
+		t.Errorf("wrong number of results: got %d, want %d", len(results), want)
+	}
+	if hasDuplicates(results) {
+		t.Errorf("result set contains duplicate entries")
+	}
+	if results := crawlAll(tab, 10); len(results) != 10 {
+		t.Errorf("limited crawl returned %d results, want 10", len(results))
+	}
+}
+
+func TestTable_CrawlCancel(t *testing.T) {
+	testnet := newCrawlTestnet(300)
+	tab := newTable(testnet, NodeID{}, &net.UDPAddr{}, "", Config{})
+	defer tab.db.close()
+	tab.add([]*Node{testnet.nodes[0]})
+
+	found, cancel := make(chan *Node), make(chan struct{})
+	go tab.Crawl(1000, found, cancel)
+	<-found
+	close(cancel)
+
+	// a few more nodes may be delivered before the crawl sees the cancel.
+	done := make(chan int)
+	go func() {
+		n := 0
+		for _ = range found {
+			n++
+		}
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		if want := testnet.reachable(0); n >= want-1 {
+			t.Errorf("crawl delivered %d more nodes after cancel", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawl did not end after cancel")
+	}
+}
+
+func crawlAll(tab *Table, maxNodes int) (results []*Node) {
+	found := make(chan *Node)
+	go tab.Crawl(maxNodes, found, nil)
+	for n := range found {
+		results = append(results, n)
+	}
+	return results
+}
+
+// crawlTestnet is a transport for the Crawl tests. Every node has a
+// table of at most bucketSize nodes per bucket and answers findnode
+// with the closest of them, like a real node. A node is identified by
+// its index plus one, which is also used as its port.
+type crawlTestnet struct {
+	nodes  []*Node
+	tables [][]*Node
+}
+
+func newCrawlTestnet(n int) *crawlTestnet {
+	tn := &crawlTestnet{nodes: make([]*Node, n), tables: make([][]*Node, n)}
+	for i := range tn.nodes {
+		var id NodeID
+		id[0], id[1] = byte((i+1)>>8), byte(i+1)
+		tn.nodes[i] = newNode(id, net.ParseIP("127.0.0.1"), uint16(i+1), 0)
+	}
+	for i, n := range tn.nodes {
+		var bucketLen [nBuckets]int
+		for _, other := range tn.nodes {
+			ld := logdist(n.sha, other.sha)
+			if other != n && bucketLen[ld] < bucketSize {
+				bucketLen[ld]++
+				tn.tables[i] = append(tn.tables[i], other)
+			}
+		}
+	}
+	return tn
+}
+
+// reachable returns the number of nodes that can be found
+// by following the tables, starting at the given node.
+func (tn *crawlTestnet) reachable(start int) int {
+	seen := map[NodeID]bool{tn.nodes[start].ID: true}
+	queue := []*Node{tn.nodes[start]}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, other := range tn.tables[n.UDP-1] {
+			if !seen[other.ID] {
+				seen[other.ID] = true
+				queue = append(queue, other)
+			}
+		}
+	}
+	return len(seen)
+}
+
+func (tn *crawlTestnet) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node, error) {
+	closest := &nodesByDistance{target: crypto.Sha3Hash(target[:])}
+	for _, n := range tn.tables[toaddr.Port-1] {
+		closest.push(n, bucketSize)
+	}
+	result := make([]*Node, len(closest.entries))
+	for i, n := range closest.entries {
+		cpy := *n
+		result[i] = &cpy
+	}
+	return result, nil
+}
+
+func (*crawlTestnet) close()                     {}
+func (*crawlTestnet) waitping(from NodeID) error { return nil }
+func (*crawlTestnet) ping(toid NodeID, toaddr *net.UDPAddr) (*PingResult, error) {
+	return &PingResult{}, nil
+}
+
 // This is the test network for the Lookup test.
 // The nodes were obtained by running testnet.mine with a random NodeID as target.
 var lookupTestnet = &preminedTestnet{
@@ -476,9 +690,11 @@ func (tn *preminedTestnet) findnode(toid NodeID, toaddr *net.UDPAddr, target Nod
 	return result, nil
 }
 
-func (*preminedTestnet) close()                                      {}
-func (*preminedTestnet) waitping(from NodeID) error                  { return nil }
-func (*preminedTestnet) ping(toid NodeID, toaddr *net.UDPAddr) error { return nil }
+func (*preminedTestnet) close()                     {}
+func (*preminedTestnet) waitping(from NodeID) error { return nil }
+func (*preminedTestnet) ping(toid NodeID, toaddr *net.UDPAddr) (*PingResult, error) {
+	return &PingResult{}, nil
+}
 
 // mine generates a testnet struct literal with nodes at
 // various distances to the given target.
@@ -12,6 +12,7 @@ import (
 	"github.com/ethereum/go-ethereum/logger"
 	"github.com/ethereum/go-ethereum/logger/glog"
 	"github.com/ethereum/go-ethereum/p2p/nat"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -27,15 +28,49 @@ var (
 	errUnknownNode      = errors.New("unknown node")
 	errTimeout          = errors.New("RPC timeout")
 	errClosed           = errors.New("socket closed")
+	errNetRestrict      = errors.New("not contained in netrestrict whitelist")
+	errRateLimited      = errors.New("rate limited")
 )
 
 // Timeouts
 const (
-	respTimeout = 500 * time.Millisecond
-	sendTimeout = 500 * time.Millisecond
-	expiration  = 20 * time.Second
+	defaultRespTimeout = 500 * time.Millisecond
+	sendTimeout        = 500 * time.Millisecond
+	expiration         = 20 * time.Second
 
-	refreshInterval = 1 * time.Hour
+	defaultRefreshInterval = 1 * time.Hour
+)
+
+// Config holds settings of the discovery protocol.
+// Fields left at their zero value are set to the package defaults.
+type Config struct {
+	// If NetRestrict is non-nil, discovery is restricted to nodes whose
+	// IP is contained in one of the given networks.
+	NetRestrict *netutil.Netlist
+
+	Alpha           int           // number of concurrent findnode requests during lookup
+	RespTimeout     time.Duration // time to wait for the reply to a request
+	RefreshInterval time.Duration // time between random lookups refreshing the table
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Alpha <= 0 {
+		cfg.Alpha = defaultAlpha
+	}
+	if cfg.RespTimeout <= 0 {
+		cfg.RespTimeout = defaultRespTimeout
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	return cfg
+}
+
+// Limits for incoming findnode requests
+const (
+	findnodeRateWindow = 1 * time.Second
+	maxFindnodePerIP   = 10   // requests answered per source IP and window
+	maxLimiterEntries  = 1024 // maximum number of tracked IPs
 )
 
 // RPC packet types
@@ -99,12 +134,15 @@ func makeEndpoint(addr *net.UDPAddr, tcpPort uint16) rpcEndpoint {
 	return rpcEndpoint{IP: ip, UDP: uint16(addr.Port), TCP: tcpPort}
 }
 
-func nodeFromRPC(rn rpcNode) (n *Node, valid bool) {
+func (t *udp) nodeFromRPC(rn rpcNode) (n *Node, valid bool) {
 	// TODO: don't accept localhost, LAN addresses from internet hosts
 	// TODO: check public key is on secp256k1 curve
 	if rn.IP.IsMulticast() || rn.IP.IsUnspecified() || rn.UDP == 0 {
 		return nil, false
 	}
+	if t.netrestrict != nil && !t.netrestrict.Contains(rn.IP) {
+		return nil, false
+	}
 	return newNode(rn.ID, rn.IP, rn.UDP, rn.TCP), true
 }
 
@@ -135,6 +173,16 @@ type udp struct {
 	closing chan struct{}
 	nat     nat.Interface
 
+	// if set, packets from and nodes outside these networks are ignored.
+	netrestrict *netutil.Netlist
+
+	respTimeout     time.Duration
+	refreshInterval time.Duration
+
+	// limits findnode requests per source IP. only accessed
+	// by the readLoop goroutine.
+	findnodeLimit *ipLimiter
+
 	*Table
 }
 
@@ -176,7 +224,9 @@ type reply struct {
 }
 
 // ListenUDP returns a new table that listens for UDP packets on laddr.
-func ListenUDP(priv *ecdsa.PrivateKey, laddr string, natm nat.Interface, nodeDBPath string) (*Table, error) {
+//
+// The zero Config selects the default protocol settings.
+func ListenUDP(priv *ecdsa.PrivateKey, laddr string, natm nat.Interface, nodeDBPath string, cfg Config) (*Table, error) {
 	addr, err := net.ResolveUDPAddr("udp", laddr)
 	if err != nil {
 		return nil, err
@@ -185,18 +235,25 @@ func ListenUDP(priv *ecdsa.PrivateKey, laddr string, natm nat.Interface, nodeDBP
 	if err != nil {
 		return nil, err
 	}
-	tab, _ := newUDP(priv, conn, natm, nodeDBPath)
+	tab, _ := newUDP(priv, conn, natm, nodeDBPath, cfg)
 	glog.V(logger.Info).Infoln("Listening,", tab.self)
 	return tab, nil
 }
 
-func newUDP(priv *ecdsa.PrivateKey, c conn, natm nat.Interface, nodeDBPath string) (*Table, *udp) {
+func newUDP(priv *ecdsa.PrivateKey, c conn, natm nat.Interface, nodeDBPath string, cfg Config) (*Table, *udp) {
+	cfg = cfg.withDefaults()
 	udp := &udp{
-		conn:       c,
-		priv:       priv,
-		closing:    make(chan struct{}),
-		gotreply:   make(chan reply),
-		addpending: make(chan *pending),
+		conn:        c,
+		priv:        priv,
+		closing:     make(chan struct{}),
+		gotreply:    make(chan reply),
+		addpending:  make(chan *pending),
+		netrestrict: cfg.NetRestrict,
+
+		respTimeout:     cfg.RespTimeout,
+		refreshInterval: cfg.RefreshInterval,
+
+		findnodeLimit: newIPLimiter(findnodeRateWindow, maxFindnodePerIP),
 	}
 	realaddr := c.LocalAddr().(*net.UDPAddr)
 	if natm != nil {
@@ -210,7 +267,7 @@ func newUDP(priv *ecdsa.PrivateKey, c conn, natm nat.Interface, nodeDBPath strin
 	}
 	// TODO: separate TCP port
 	udp.ourEndpoint = makeEndpoint(realaddr, uint16(realaddr.Port))
-	udp.Table = newTable(udp, PubkeyID(&priv.PublicKey), realaddr, nodeDBPath)
+	udp.Table = newTable(udp, PubkeyID(&priv.PublicKey), realaddr, nodeDBPath, cfg)
 	go udp.loop()
 	go udp.readLoop()
 	return udp.Table, udp
@@ -223,16 +280,40 @@ func (t *udp) close() {
 }
 
 // ping sends a ping message to the given node and waits for a reply.
-func (t *udp) ping(toid NodeID, toaddr *net.UDPAddr) error {
-	// TODO: maybe check for ReplyTo field in callback to measure RTT
-	errc := t.pending(toid, pongPacket, func(interface{}) bool { return true })
-	t.send(toaddr, pingPacket, ping{
+// Only a pong carrying the hash of the ping packet is accepted as the
+// reply, confirming that the remote endpoint actually received it.
+func (t *udp) ping(toid NodeID, toaddr *net.UDPAddr) (*PingResult, error) {
+	req := ping{
 		Version:    Version,
 		From:       t.ourEndpoint,
 		To:         makeEndpoint(toaddr, 0), // TODO: maybe use known TCP port from DB
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	}
+	packet, err := encodePacket(t.priv, pingPacket, req)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		sent, received time.Time
+		seen           rpcEndpoint
+	)
+	errc := t.pending(toid, pongPacket, func(p interface{}) bool {
+		reply := p.(*pong)
+		if !bytes.Equal(reply.ReplyTok, packet[:macSize]) {
+			return false
+		}
+		received, seen = time.Now(), reply.To
+		return true
 	})
-	return <-errc
+	sent = time.Now()
+	t.write(toaddr, req, packet)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return &PingResult{
+		RTT:  received.Sub(sent),
+		Seen: &net.UDPAddr{IP: seen.IP, Port: int(seen.UDP)},
+	}, nil
 }
 
 func (t *udp) waitping(from NodeID) error {
@@ -248,7 +329,7 @@ func (t *udp) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node
 		reply := r.(*neighbors)
 		for _, rn := range reply.Nodes {
 			nreceived++
-			if n, valid := nodeFromRPC(rn); valid {
+			if n, valid := t.nodeFromRPC(rn); valid {
 				nodes = append(nodes, n)
 			}
 		}
@@ -294,7 +375,7 @@ func (t *udp) loop() {
 		pending      []*pending
 		nextDeadline time.Time
 		timeout      = time.NewTimer(0)
-		refresh      = time.NewTicker(refreshInterval)
+		refresh      = time.NewTicker(t.refreshInterval)
 	)
 	<-timeout.C // ignore first timeout
 	defer refresh.Stop()
@@ -322,7 +403,7 @@ func (t *udp) loop() {
 			return
 
 		case p := <-t.addpending:
-			p.deadline = time.Now().Add(respTimeout)
+			p.deadline = time.Now().Add(t.respTimeout)
 			pending = append(pending, p)
 			rearmTimeout()
 
@@ -370,8 +451,14 @@ func (t *udp) send(toaddr *net.UDPAddr, ptype byte, req interface{}) error {
 	if err != nil {
 		return err
 	}
+	return t.write(toaddr, req, packet)
+}
+
+// write sends an encoded packet. req is used for logging only.
+func (t *udp) write(toaddr *net.UDPAddr, req interface{}, packet []byte) error {
 	glog.V(logger.Detail).Infof(">>> %v %T\n", toaddr, req)
-	if _, err = t.conn.WriteToUDP(packet, toaddr); err != nil {
+	_, err := t.conn.WriteToUDP(packet, toaddr)
+	if err != nil {
 		glog.V(logger.Detail).Infoln("UDP send failed:", err)
 	}
 	return err
@@ -413,6 +500,10 @@ func (t *udp) readLoop() {
 }
 
 func (t *udp) handlePacket(from *net.UDPAddr, buf []byte) error {
+	if t.netrestrict != nil && !t.netrestrict.Contains(from.IP) {
+		glog.V(logger.Detail).Infof("Ignoring packet from %v: %v\n", from, errNetRestrict)
+		return errNetRestrict
+	}
 	packet, fromID, hash, err := decodePacket(buf)
 	if err != nil {
 		glog.V(logger.Debug).Infof("Bad packet from %v: %v\n", from, err)
@@ -489,25 +580,36 @@ func (req *findnode) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte
 	if expired(req.Expiration) {
 		return errExpired
 	}
-	if t.db.node(fromID) == nil {
-		// No bond exists, we don't process the packet. This prevents
-		// an attack vector where the discovery protocol could be used
-		// to amplify traffic in a DDOS attack. A malicious actor
-		// would send a findnode request with the IP address and UDP
-		// port of the target as the source address. The recipient of
-		// the findnode packet would then send a neighbors packet
-		// (which is a much bigger packet than findnode) to the victim.
+	if n := t.db.node(fromID); n == nil || !t.db.hasBond(fromID) || !n.IP.Equal(from.IP) || int(n.UDP) != from.Port {
+		// No recent bond exists with the sending endpoint, we don't
+		// process the packet. This prevents an attack vector where the
+		// discovery protocol could be used to amplify traffic in a DDOS
+		// attack. A malicious actor would send a findnode request with
+		// the IP address and UDP port of the target as the source
+		// address. The recipient of the findnode packet would then send
+		// a neighbors packet (which is a much bigger packet than
+		// findnode) to the victim. Checking the endpoint ensures that a
+		// bond made from the attacker's own address can't be reused.
 		return errUnknownNode
 	}
+	if !t.findnodeLimit.allow(from.IP, time.Now()) {
+		// Even bonded nodes may only ask a limited number of
+		// questions per IP, bounding the traffic we can be made
+		// to generate towards any single address.
+		return errRateLimited
+	}
 	target := crypto.Sha3Hash(req.Target[:])
 	t.mutex.Lock()
 	closest := t.closest(target, bucketSize).entries
 	t.mutex.Unlock()
 
 	// TODO: this conversion could use a cached version of the slice
-	closestrpc := make([]rpcNode, len(closest))
-	for i, n := range closest {
-		closestrpc[i] = nodeToRPC(n)
+	closestrpc := make([]rpcNode, 0, len(closest))
+	for _, n := range closest {
+		if t.netrestrict != nil && !t.netrestrict.Contains(n.IP) {
+			continue
+		}
+		closestrpc = append(closestrpc, nodeToRPC(n))
 	}
 	t.send(from, neighborsPacket, neighbors{
 		Nodes:      closestrpc,
@@ -529,3 +631,55 @@ func (req *neighbors) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byt
 func expired(ts uint64) bool {
 	return time.Unix(int64(ts), 0).Before(time.Now())
 }
+
+// ipLimiter counts events per IP address in fixed time windows.
+// At most maxLimiterEntries addresses are tracked, events from
+// further addresses are refused until entries expire.
+type ipLimiter struct {
+	window    time.Duration
+	limit     int
+	counts    map[string]*ipCount
+	lastSweep time.Time
+}
+
+type ipCount struct {
+	start time.Time // beginning of the current window
+	n     int       // events seen within the window
+}
+
+func newIPLimiter(window time.Duration, limit int) *ipLimiter {
+	return &ipLimiter{window: window, limit: limit, counts: make(map[string]*ipCount)}
+}
+
+// allow records an event from ip and reports whether it is
+// within the limit for the current window.
+func (l *ipLimiter) allow(ip net.IP, now time.Time) bool {
+	key := string(ip.To16())
+	c := l.counts[key]
+	if c == nil && len(l.counts) >= maxLimiterEntries {
+		// Sweeping is linear in the number of entries, do it
+		// at most once per window.
+		if now.Sub(l.lastSweep) >= l.window {
+			l.sweep(now)
+			l.lastSweep = now
+		}
+		if len(l.counts) >= maxLimiterEntries {
+			return false
+		}
+	}
+	if c == nil || now.Sub(c.start) >= l.window {
+		c = &ipCount{start: now}
+		l.counts[key] = c
+	}
+	c.n++
+	return c.n <= l.limit
+}
+
+// sweep drops all entries whose window has ended.
+func (l *ipLimiter) sweep(now time.Time) {
+	for key, c := range l.counts {
+		if now.Sub(c.start) >= l.window {
+			delete(l.counts, key)
+		}
+	}
+}
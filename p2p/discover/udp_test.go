@@ -18,6 +18,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/logger"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
 )
 
 func init() {
@@ -51,10 +52,17 @@ func newUDPTest(t *testing.T) *udpTest {
 		remotekey:  newkey(),
 		remoteaddr: &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 30303},
 	}
-	test.table, test.udp = newUDP(test.localkey, test.pipe, nil, "")
+	test.table, test.udp = newUDP(test.localkey, test.pipe, nil, "", Config{})
 	return test
 }
 
+// bond records a recent bond with the remote test node.
+func (test *udpTest) bond() {
+	remoteID := PubkeyID(&test.remotekey.PublicKey)
+	test.table.db.updateNode(newNode(remoteID, test.remoteaddr.IP, uint16(test.remoteaddr.Port), 99))
+	test.table.db.updateLastPong(remoteID, time.Now())
+}
+
 // handles a packet as if it had been sent to the transport.
 func (test *udpTest) packetIn(wantError error, ptype byte, data packet) error {
 	enc, err := encodePacket(test.remotekey, ptype, data)
@@ -68,21 +76,21 @@ func (test *udpTest) packetIn(wantError error, ptype byte, data packet) error {
 	return nil
 }
 
-// waits for a packet to be sent by the transport.
+// waits for a packet to be sent by the transport and returns its hash.
 // validate should have type func(*udpTest, X) error, where X is a packet type.
-func (test *udpTest) waitPacketOut(validate interface{}) error {
+func (test *udpTest) waitPacketOut(validate interface{}) ([]byte, error) {
 	dgram := test.pipe.waitPacketOut()
-	p, _, _, err := decodePacket(dgram)
+	p, _, hash, err := decodePacket(dgram)
 	if err != nil {
-		return test.errorf("sent packet decode error: %v", err)
+		return hash, test.errorf("sent packet decode error: %v", err)
 	}
 	fn := reflect.ValueOf(validate)
 	exptype := fn.Type().In(0)
 	if reflect.TypeOf(p) != exptype {
-		return test.errorf("sent packet type mismatch, got: %v, want: %v", reflect.TypeOf(p), exptype)
+		return hash, test.errorf("sent packet type mismatch, got: %v, want: %v", reflect.TypeOf(p), exptype)
 	}
 	fn.Call([]reflect.Value{reflect.ValueOf(p)})
-	return nil
+	return hash, nil
 }
 
 func (test *udpTest) errorf(format string, args ...interface{}) error {
@@ -117,11 +125,35 @@ func TestUDP_pingTimeout(t *testing.T) {
 
 	toaddr := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 2222}
 	toid := NodeID{1, 2, 3, 4}
-	if err := test.udp.ping(toid, toaddr); err != errTimeout {
+	if _, err := test.udp.ping(toid, toaddr); err != errTimeout {
 		t.Error("expected timeout error, got", err)
 	}
 }
 
+func TestUDP_config(t *testing.T) {
+	t.Parallel()
+	cfg := Config{NetRestrict: new(netutil.Netlist), Alpha: 5, RespTimeout: 50 * time.Millisecond}
+	tab, udp := newUDP(newkey(), newpipe(), nil, "", cfg)
+	defer tab.Close()
+
+	if udp.netrestrict != cfg.NetRestrict {
+		t.Errorf("netrestrict not set from config")
+	}
+	if tab.alpha != cfg.Alpha {
+		t.Errorf("alpha mismatch: got %d, want %d", tab.alpha, cfg.Alpha)
+	}
+	if udp.refreshInterval != defaultRefreshInterval {
+		t.Errorf("refresh interval not defaulted: got %v, want %v", udp.refreshInterval, defaultRefreshInterval)
+	}
+	start := time.Now()
+	if _, err := udp.ping(NodeID{1, 2, 3, 4}, &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 2222}); err != errTimeout {
+		t.Fatal("expected timeout error, got", err)
+	}
+	if elapsed := time.Since(start); elapsed >= defaultRespTimeout {
+		t.Errorf("ping took %v, configured response timeout is %v", elapsed, cfg.RespTimeout)
+	}
+}
+
 func TestUDP_findnodeTimeout(t *testing.T) {
 	t.Parallel()
 	test := newUDPTest(t)
@@ -155,12 +187,7 @@ func TestUDP_findnode(t *testing.T) {
 
 	// ensure there's a bond with the test node,
 	// findnode won't be accepted otherwise.
-	test.table.db.updateNode(newNode(
-		PubkeyID(&test.remotekey.PublicKey),
-		test.remoteaddr.IP,
-		uint16(test.remoteaddr.Port),
-		99,
-	))
+	test.bond()
 	// check that closest neighbors are returned.
 	test.packetIn(nil, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
 	test.waitPacketOut(func(p *neighbors) {
@@ -176,6 +203,141 @@ func TestUDP_findnode(t *testing.T) {
 	})
 }
 
+func TestUDP_findnodeStaleBond(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	// the remote node is known, but hasn't answered a ping in a long time.
+	remoteID := PubkeyID(&test.remotekey.PublicKey)
+	test.table.db.updateNode(newNode(remoteID, test.remoteaddr.IP, uint16(test.remoteaddr.Port), 99))
+	test.table.db.updateLastPong(remoteID, time.Now().Add(-nodeDBNodeExpiration-time.Minute))
+
+	test.packetIn(errUnknownNode, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+}
+
+func TestUDP_findnodeRateLimit(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+	test.bond()
+
+	for i := 0; i < maxFindnodePerIP; i++ {
+		test.packetIn(nil, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+		test.waitPacketOut(func(p *neighbors) {})
+	}
+	test.packetIn(errRateLimited, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+
+	// the same node ID at another address has no bond and doesn't
+	// escape the limit.
+	test.remoteaddr = &net.UDPAddr{IP: net.IP{5, 6, 7, 8}, Port: 30303}
+	test.packetIn(errUnknownNode, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+
+	// nodes bonded at other addresses are not affected.
+	test.remotekey = newkey()
+	test.bond()
+	test.packetIn(nil, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+}
+
+func TestUDP_findnodeForgedSource(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+	test.bond()
+
+	// the bond is only valid for the endpoint that answered the ping.
+	// requests with a forged source address are not answered.
+	bonded := test.remoteaddr
+	test.remoteaddr = &net.UDPAddr{IP: net.IP{5, 6, 7, 8}, Port: bonded.Port}
+	test.packetIn(errUnknownNode, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+	test.remoteaddr = &net.UDPAddr{IP: bonded.IP, Port: bonded.Port + 1}
+	test.packetIn(errUnknownNode, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+
+	test.remoteaddr = bonded
+	test.packetIn(nil, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+}
+
+func TestUDP_findnodeEndpointChange(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+	test.bond()
+
+	// the remote node moves to another address and pings us from there.
+	newaddr := &net.UDPAddr{IP: net.IP{5, 6, 7, 8}, Port: 30304}
+	test.remoteaddr = newaddr
+	test.packetIn(nil, pingPacket, &ping{From: testRemote, To: testLocalAnnounced, Version: Version, Expiration: futureExp})
+	test.waitPacketOut(func(p *pong) {})
+
+	// the stored endpoint is stale, so the table pings back to bond again.
+	hash, _ := test.waitPacketOut(func(p *ping) {})
+	test.packetIn(nil, pongPacket, &pong{ReplyTok: hash, Expiration: futureExp})
+
+	remoteID := PubkeyID(&test.remotekey.PublicKey)
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := test.table.db.node(remoteID)
+		if n != nil && n.IP.Equal(newaddr.IP) && int(n.UDP) == newaddr.Port {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node endpoint not updated: %v", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.packetIn(nil, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+}
+
+func TestIPLimiter(t *testing.T) {
+	var (
+		l     = newIPLimiter(time.Second, 2)
+		ip    = net.IP{1, 2, 3, 4}
+		start = time.Now()
+	)
+	for i, want := range []bool{true, true, false, false} {
+		if got := l.allow(ip, start.Add(time.Duration(i)*time.Millisecond)); got != want {
+			t.Errorf("event %d: allow = %t, want %t", i, got, want)
+		}
+	}
+	if !l.allow(ip, start.Add(time.Second)) {
+		t.Error("event in next window not allowed")
+	}
+	if !l.allow(net.IP{4, 3, 2, 1}, start) {
+		t.Error("event from other IP not allowed")
+	}
+	l.sweep(start.Add(3 * time.Second))
+	if len(l.counts) != 0 {
+		t.Errorf("%d entries left after sweep, want none", len(l.counts))
+	}
+}
+
+func TestIPLimiterCap(t *testing.T) {
+	var (
+		l     = newIPLimiter(time.Second, 2)
+		start = time.Now()
+	)
+	for i := 0; i < maxLimiterEntries; i++ {
+		ip := net.IP{10, 0, byte(i >> 8), byte(i)}
+		if !l.allow(ip, start) {
+			t.Fatalf("event from %v refused before reaching the cap", ip)
+		}
+	}
+	// tracked addresses keep working, new ones are refused.
+	if !l.allow(net.IP{10, 0, 0, 0}, start) {
+		t.Error("event from tracked IP refused at the cap")
+	}
+	if l.allow(net.IP{1, 2, 3, 4}, start.Add(time.Millisecond)) {
+		t.Error("event from new IP allowed above the cap")
+	}
+	if len(l.counts) != maxLimiterEntries {
+		t.Errorf("tracking %d entries, want %d", len(l.counts), maxLimiterEntries)
+	}
+	// once the entries have expired and the next sweep is due,
+	// new addresses are accepted again.
+	if !l.allow(net.IP{1, 2, 3, 4}, start.Add(2*time.Second)) {
+		t.Error("event from new IP refused after the entries expired")
+	}
+	if len(l.counts) != 1 {
+		t.Errorf("tracking %d entries after sweep, want 1", len(l.counts))
+	}
+}
+
 func TestUDP_findnodeMultiReply(t *testing.T) {
 	test := newUDPTest(t)
 	defer test.table.Close()
@@ -227,6 +389,107 @@ func TestUDP_findnodeMultiReply(t *testing.T) {
 	}
 }
 
+func TestUDP_netrestrict(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	restrict := new(netutil.Netlist)
+	restrict.Add("10.0.0.0/8")
+	test.udp.netrestrict = restrict
+
+	// packets from outside the whitelist are ignored.
+	test.packetIn(errNetRestrict, pingPacket, &ping{From: testRemote, To: testLocalAnnounced, Version: Version, Expiration: futureExp})
+
+	// neighbors outside the whitelist are not returned by findnode.
+	restrict.Add("1.2.3.0/24")
+	resultc := make(chan []*Node)
+	go func() {
+		ns, _ := test.udp.findnode(PubkeyID(&test.remotekey.PublicKey), test.remoteaddr, testTarget)
+		resultc <- ns
+	}()
+	test.waitPacketOut(func(p *findnode) {})
+
+	inside := MustParseNode("enode://ba85011c70bcc5c04d8607d3a0ed29aa6179c092cbdda10d5d32684fb33ed01bd94f588ca8f91ac48318087dcb02eaf36773a7a453f0eedd6742af668097b29c@10.0.1.16:30303?discport=30304")
+	outside := MustParseNode("enode://81fa361d25f157cd421c60dcc28d8dac5ef6a89476633339c5df30287474520caca09627da18543d9079b5b288698b542d56167aa5c09111e55acdbbdf2ef799@192.168.0.1:30303")
+	test.packetIn(nil, neighborsPacket, &neighbors{Expiration: futureExp, Nodes: []rpcNode{nodeToRPC(inside), nodeToRPC(outside)}})
+
+	select {
+	case result := <-resultc:
+		if !reflect.DeepEqual(result, []*Node{inside}) {
+			t.Errorf("neighbors mismatch:\n  got:  %v\n  want: %v", result, []*Node{inside})
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("findnode did not return within 5 seconds")
+	}
+}
+
+func TestUDP_findnodeNetrestrict(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	restrict := new(netutil.Netlist)
+	restrict.Add("10.0.0.0/8")
+	restrict.Add("1.2.3.0/24")
+	test.udp.netrestrict = restrict
+
+	// put nodes inside and outside the whitelist into the table.
+	inside := nodeAtDistance(test.table.self.sha, 200)
+	inside.IP, inside.UDP = net.IP{10, 0, 1, 16}, 30303
+	outside := nodeAtDistance(test.table.self.sha, 201)
+	outside.IP, outside.UDP = net.IP{192, 168, 0, 1}, 30303
+	test.table.add([]*Node{inside, outside})
+
+	// the bonded requester is inside the whitelist, but the
+	// reply must not contain the node outside of it.
+	test.bond()
+	test.packetIn(nil, findnodePacket, &findnode{Target: testTarget, Expiration: futureExp})
+	test.waitPacketOut(func(p *neighbors) {
+		if len(p.Nodes) != 1 || p.Nodes[0].ID != inside.ID {
+			t.Errorf("neighbors mismatch:\n  got:  %v\n  want: %v", p.Nodes, []rpcNode{nodeToRPC(inside)})
+		}
+	})
+}
+
+func TestUDP_pingReplyTok(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	var (
+		rid   = PubkeyID(&test.remotekey.PublicKey)
+		res   *PingResult
+		errc  = make(chan error)
+		delay = test.udp.respTimeout / 5
+	)
+	go func() {
+		var err error
+		res, err = test.udp.ping(rid, test.remoteaddr)
+		errc <- err
+	}()
+	hash, _ := test.waitPacketOut(func(p *ping) {})
+
+	// a pong that doesn't echo the ping hash is not accepted as the reply.
+	test.packetIn(nil, pongPacket, &pong{ReplyTok: []byte{1, 2, 3}, Expiration: futureExp})
+	select {
+	case err := <-errc:
+		t.Fatalf("ping returned early with %v", err)
+	case <-time.After(delay):
+	}
+	test.packetIn(nil, pongPacket, &pong{To: testLocalAnnounced, ReplyTok: hash, Expiration: futureExp})
+	if err := <-errc; err != nil {
+		t.Fatalf("ping error: %v", err)
+	}
+
+	// the result reports the time until the matching pong and the
+	// endpoint the remote node saw us at.
+	if res.RTT < delay {
+		t.Errorf("round-trip time %v shorter than pong delay %v", res.RTT, delay)
+	}
+	wantSeen := &net.UDPAddr{IP: testLocalAnnounced.IP, Port: int(testLocalAnnounced.UDP)}
+	if !reflect.DeepEqual(res.Seen, wantSeen) {
+		t.Errorf("got seen endpoint %v, want %v", res.Seen, wantSeen)
+	}
+}
+
 func TestUDP_successfulPing(t *testing.T) {
 	test := newUDPTest(t)
 	defer test.table.Close()
@@ -256,7 +519,7 @@ func TestUDP_successfulPing(t *testing.T) {
 	})
 
 	// remote is unknown, the table pings back.
-	test.waitPacketOut(func(p *ping) error {
+	hash, _ := test.waitPacketOut(func(p *ping) error {
 		if !reflect.DeepEqual(p.From, test.udp.ourEndpoint) {
 			t.Errorf("got ping.From %v, want %v", p.From, test.udp.ourEndpoint)
 		}
@@ -270,7 +533,7 @@ func TestUDP_successfulPing(t *testing.T) {
 		}
 		return nil
 	})
-	test.packetIn(nil, pongPacket, &pong{Expiration: futureExp})
+	test.packetIn(nil, pongPacket, &pong{ReplyTok: hash, Expiration: futureExp})
 
 	// ping should return shortly after getting the pong packet.
 	<-done
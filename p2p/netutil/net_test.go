@@ -0,0 +1,70 @@
+package netutil
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetlist(t *testing.T) {
+	var tests = []struct {
+		input    string
+		wantErr  error
+		wantList *Netlist
+	}{
+		{
+			input:    "",
+			wantList: &Netlist{},
+		},
+		{
+			input:    "127.0.0.0/8",
+			wantErr:  nil,
+			wantList: &Netlist{{IP: net.IP{127, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}},
+		},
+		{
+			input:   "127.0.0.0/44",
+			wantErr: &net.ParseError{Type: "CIDR address", Text: "127.0.0.0/44"},
+		},
+		{
+			input: "127.0.0.0/16, 23.23.23.23/24,",
+			wantList: &Netlist{
+				{IP: net.IP{127, 0, 0, 0}, Mask: net.CIDRMask(16, 32)},
+				{IP: net.IP{23, 23, 23, 0}, Mask: net.CIDRMask(24, 32)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		l, err := ParseNetlist(test.input)
+		if !reflect.DeepEqual(err, test.wantErr) {
+			t.Errorf("%q: got error %q, want %q", test.input, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(l, test.wantList) {
+			t.Errorf("%q: got %v, want %v", test.input, l, test.wantList)
+		}
+	}
+}
+
+func TestNetlistContains(t *testing.T) {
+	var l Netlist
+	l.Add("127.0.0.0/8")
+	l.Add("10.0.0.0/8")
+	l.Add("fe80::/10")
+
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "fe80::1"} {
+		if !l.Contains(net.ParseIP(ip)) {
+			t.Errorf("%s not contained in %v", ip, l)
+		}
+	}
+	for _, ip := range []string{"192.168.0.1", "8.8.8.8", "2001:db8::1"} {
+		if l.Contains(net.ParseIP(ip)) {
+			t.Errorf("%s unexpectedly contained in %v", ip, l)
+		}
+	}
+
+	var nilList *Netlist
+	if nilList.Contains(net.ParseIP("127.0.0.1")) {
+		t.Error("nil list should not contain any IP")
+	}
+}
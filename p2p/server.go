@@ -90,6 +90,10 @@ type Server struct {
 	// Internet.
 	NAT nat.Interface
 
+	// Discovery holds the settings of the node discovery protocol.
+	// The zero value selects the defaults.
+	Discovery discover.Config
+
 	// If Dialer is set to a non-nil value, the given Dialer
 	// is used to dial outbound peer connections.
 	Dialer *net.Dialer
@@ -153,6 +157,32 @@ func (srv *Server) AddPeer(node *discover.Node) {
 	srv.staticNodes[node.ID] = node
 }
 
+// Ping sends a discovery ping to the given node and returns the
+// round-trip time of the exchange and the endpoint the node saw us at.
+func (srv *Server) Ping(node *discover.Node) (*discover.PingResult, error) {
+	srv.lock.RLock()
+	running, ntab := srv.running, srv.ntab
+	srv.lock.RUnlock()
+	if !running {
+		return nil, errors.New("server not running")
+	}
+	return ntab.Ping(node)
+}
+
+// Crawl enumerates the discovery network in the background. Up to
+// maxNodes nodes are sent on found as they are discovered. found is
+// closed when the crawl ends, at the latest when the server is stopped.
+func (srv *Server) Crawl(maxNodes int, found chan<- *discover.Node) error {
+	srv.lock.RLock()
+	running, ntab, quit := srv.running, srv.ntab, srv.quit
+	srv.lock.RUnlock()
+	if !running {
+		return errors.New("server not running")
+	}
+	go ntab.Crawl(maxNodes, found, quit)
+	return nil
+}
+
 // Broadcast sends an RLP-encoded message to all connected peers.
 // This method is deprecated and will be removed later.
 func (srv *Server) Broadcast(protocol string, code uint64, data interface{}) error {
@@ -228,7 +258,7 @@ func (srv *Server) Start() (err error) {
 	}
 
 	// node table
-	ntab, err := discover.ListenUDP(srv.PrivateKey, srv.ListenAddr, srv.NAT, srv.NodeDatabase)
+	ntab, err := discover.ListenUDP(srv.PrivateKey, srv.ListenAddr, srv.NAT, srv.NodeDatabase, srv.Discovery)
 	if err != nil {
 		return err
 	}
@@ -434,7 +464,11 @@ func (srv *Server) dialLoop() {
 				go func() {
 					var target discover.NodeID
 					rand.Read(target[:])
-					findresults <- srv.ntab.Lookup(target)
+					result := srv.ntab.LookupCancel(target, srv.quit)
+					select {
+					case findresults <- result:
+					case <-srv.quit:
+					}
 				}()
 			} else {
 				// Make sure we check again if the peer count falls